@@ -0,0 +1,200 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// staticAssetMeta is the precomputed caching info for a StaticPath route,
+// built once in [computeStaticMeta] instead of re-stat'd/re-hashed on
+// every request.
+type staticAssetMeta struct {
+	ETag    string
+	ModTime time.Time
+}
+
+// computeStaticMeta hashes the contents of every StaticPath route so its
+// ETag is a strong validator, and records its mtime for Last-Modified.
+func computeStaticMeta(manifestDir string, routes map[string]Route) (map[string]staticAssetMeta, error) {
+	meta := make(map[string]staticAssetMeta, len(routes))
+
+	for routePath, route := range routes {
+		if route.StaticPath == "" {
+			continue
+		}
+
+		fPath := filepath.Join(manifestDir, route.StaticPath)
+		f, err := os.Open(fPath)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %q: %s", fPath, err)
+		}
+
+		h := sha256.New()
+		_, copyErr := io.Copy(h, f)
+		info, statErr := f.Stat()
+		f.Close()
+		if copyErr != nil {
+			return nil, fmt.Errorf("error hashing %q: %s", fPath, copyErr)
+		}
+		if statErr != nil {
+			return nil, fmt.Errorf("error statting %q: %s", fPath, statErr)
+		}
+
+		meta[routePath] = staticAssetMeta{
+			ETag:    `"` + hex.EncodeToString(h.Sum(nil)) + `"`,
+			ModTime: info.ModTime(),
+		}
+	}
+
+	return meta, nil
+}
+
+// bodyETag returns a strong ETag for an already-rendered response body.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// cachePolicyFor returns the [CachePolicy] in policies whose pattern matches
+// routePath, using shell-style matching via [path.Match]. When more than one
+// pattern matches, the longest (most specific) pattern wins; patterns of
+// equal length are then broken lexically, so the result is fully
+// deterministic regardless of map iteration order.
+func cachePolicyFor(routePath string, policies map[string]CachePolicy) (CachePolicy, bool) {
+	patterns := make([]string, 0, len(policies))
+	for pattern := range policies {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, routePath); err == nil && ok {
+			return policies[pattern], true
+		}
+	}
+	return CachePolicy{}, false
+}
+
+// writeCacheControl sets Cache-Control from a matched policy, if any.
+func writeCacheControl(w http.ResponseWriter, policy CachePolicy, matched bool) {
+	if !matched {
+		return
+	}
+	v := "max-age=" + strconv.Itoa(policy.MaxAge)
+	if policy.Immutable {
+		v += ", immutable"
+	}
+	w.Header().Set("Cache-Control", v)
+}
+
+// isNotModified reports whether the request's conditional headers show the
+// client's cached copy is still fresh, per If-None-Match (preferred, since
+// it's a strong comparison) and otherwise If-Modified-Since.
+func isNotModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return inm == etag
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !modTime.After(t)
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks a compressed encoding to use for the response
+// body based on the client's Accept-Encoding, preferring brotli. An
+// encoding explicitly disabled with "q=0" is treated as not offered.
+func negotiateEncoding(r *http.Request) string {
+	accept := r.Header.Get("Accept-Encoding")
+	for _, candidate := range []string{"br", "gzip"} {
+		if acceptsEncoding(accept, candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// acceptsEncoding reports whether encoding appears in an Accept-Encoding
+// header value with a nonzero q-value (absence of "q" defaults to 1).
+func acceptsEncoding(accept, encoding string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		name, params, hasParams := strings.Cut(strings.TrimSpace(part), ";")
+		if name != encoding {
+			continue
+		}
+		if !hasParams {
+			return true
+		}
+		return encodingQValue(params) != 0
+	}
+	return false
+}
+
+// encodingQValue parses the "q" param out of an Accept-Encoding entry's
+// parameter string (e.g. "q=0.8"), defaulting to 1 if absent or malformed.
+func encodingQValue(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || strings.TrimSpace(name) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 1
+		}
+		return q
+	}
+	return 1
+}
+
+// writeBody sends body to w, compressing it with the negotiated encoding
+// (if any) and always setting Vary so caches don't serve the wrong
+// representation to a client that doesn't support it.
+//
+// Content-Type is set (by sniffing body, same as net/http would do by
+// default) before any compression happens; otherwise the ResponseWriter
+// would sniff the compressed bytes themselves and mislabel the response
+// as application/x-gzip or similar instead of its real content type.
+func writeBody(w http.ResponseWriter, r *http.Request, body []byte) error {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType(body))
+	}
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	switch negotiateEncoding(r) {
+	case "br":
+		w.Header().Set("Content-Encoding", "br")
+		bw := brotli.NewWriter(w)
+		defer bw.Close()
+		_, err := bw.Write(body)
+		return err
+	case "gzip":
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		defer gw.Close()
+		_, err := gw.Write(body)
+		return err
+	default:
+		_, err := w.Write(body)
+		return err
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jdholdren/smolblog/internal/markdown"
+	"gopkg.in/yaml.v3"
+)
+
+// Collection describes a set of markdown files that should be treated as
+// routes: one per file, plus an aggregated index.
+//
+//	"posts": {
+//	  "glob": "content/posts/*.md",
+//	  "template": "post.tmpl",
+//	  "route": "/blog/{slug}/",
+//	  "index_template": "blog_index.tmpl",
+//	  "index_route": "/blog/"
+//	}
+type Collection struct {
+	Glob          string `json:"glob"`
+	Template      string `json:"template"`
+	Route         string `json:"route"`
+	IndexTemplate string `json:"index_template"`
+	IndexRoute    string `json:"index_route"`
+}
+
+// FrontMatter is the YAML block at the top of a collection file, delimited
+// by `---` lines.
+type FrontMatter struct {
+	Title string    `yaml:"title"`
+	Date  time.Time `yaml:"date"`
+	Tags  []string  `yaml:"tags"`
+	Draft bool      `yaml:"draft"`
+	Slug  string    `yaml:"slug"`
+}
+
+// CollectionEntry is one rendered item of a collection, as handed to
+// templates through a route's Args or the `posts`/`postsByTag`/
+// `recentPosts` funcs.
+type CollectionEntry struct {
+	Path    string
+	Meta    FrontMatter
+	Excerpt string
+	Content template.HTML
+}
+
+// excerptWords is how many words of the markdown body are kept for an
+// entry's Excerpt. The excerpt is always taken from the body; front
+// matter has no field that overrides it.
+const excerptWords = 40
+
+// loadCollectionEntries globs every file in col.Glob (resolved relative to
+// manifestDir), parses its front matter, and renders its body through md.
+// Drafts are skipped. Entries come back sorted newest first.
+func loadCollectionEntries(manifestDir string, col Collection, md *markdown.Renderer) ([]CollectionEntry, error) {
+	matches, err := filepath.Glob(filepath.Join(manifestDir, col.Glob))
+	if err != nil {
+		return nil, fmt.Errorf("error globbing %q: %s", col.Glob, err)
+	}
+
+	entries := make([]CollectionEntry, 0, len(matches))
+	for _, m := range matches {
+		byts, err := os.ReadFile(m)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %q: %s", m, err)
+		}
+
+		fm, body, err := parseFrontMatter(byts)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing front matter in %q: %s", m, err)
+		}
+		if fm.Draft {
+			continue
+		}
+		if fm.Slug == "" {
+			fm.Slug = strings.TrimSuffix(filepath.Base(m), filepath.Ext(m))
+		}
+
+		rendered, err := md.Render(body)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering markdown in %q: %s", m, err)
+		}
+
+		entries = append(entries, CollectionEntry{
+			Path:    collectionRoutePath(col.Route, fm.Slug),
+			Meta:    fm,
+			Excerpt: excerpt(body),
+			Content: rendered,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Meta.Date.After(entries[j].Meta.Date)
+	})
+
+	return entries, nil
+}
+
+// parseFrontMatter splits a file into its leading `---`-delimited YAML
+// block and the remaining markdown body. A file with no front matter
+// block is returned as an all-body file with zero-value metadata.
+func parseFrontMatter(byts []byte) (FrontMatter, []byte, error) {
+	const delim = "---"
+
+	text := string(byts)
+	if !strings.HasPrefix(text, delim) {
+		return FrontMatter{}, byts, nil
+	}
+
+	rest := text[len(delim):]
+	idx := strings.Index(rest, "\n"+delim)
+	if idx == -1 {
+		return FrontMatter{}, byts, fmt.Errorf("unterminated front matter block")
+	}
+
+	var fm FrontMatter
+	if err := yaml.Unmarshal([]byte(rest[:idx]), &fm); err != nil {
+		return FrontMatter{}, nil, fmt.Errorf("error unmarshaling front matter: %s", err)
+	}
+
+	body := strings.TrimPrefix(rest[idx+len(delim)+1:], "\n")
+	return fm, []byte(body), nil
+}
+
+// mdLinkSyntax matches markdown links and images, capturing just the link
+// text (empty for images, since there's no reasonable plain-text fallback
+// for alt text truncated mid-sentence).
+var mdLinkSyntax = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)|\[([^\]]*)\]\([^)]*\)`)
+
+// mdFormattingSyntax matches the single-character markdown tokens that
+// survive word-splitting: heading/quote/list markers and emphasis.
+var mdFormattingSyntax = regexp.MustCompile("[#>*_`~]")
+
+// excerpt returns the first excerptWords words of a markdown body, stripped
+// of formatting just enough to be readable as plain text.
+func excerpt(body []byte) string {
+	plain := mdFormattingSyntax.ReplaceAllString(
+		mdLinkSyntax.ReplaceAllString(string(body), "$1"),
+		"",
+	)
+
+	fields := strings.Fields(plain)
+	if len(fields) > excerptWords {
+		fields = fields[:excerptWords]
+	}
+	return strings.Join(fields, " ")
+}
+
+// collectionRoutePath substitutes {slug} in a collection's route pattern.
+func collectionRoutePath(routePattern, slug string) string {
+	return strings.ReplaceAll(routePattern, "{slug}", slug)
+}
+
+// synthesizeCollectionRoutes turns loaded collection entries into real
+// Manifest routes: one per entry, using the collection's Template, plus
+// an index route whose Args carries every entry for the collection.
+func synthesizeCollectionRoutes(man *Manifest, collections map[string][]CollectionEntry) {
+	for name, col := range man.Collections {
+		entries := collections[name]
+
+		for _, entry := range entries {
+			man.Routes[entry.Path] = Route{
+				Template: col.Template,
+				Args: map[string]any{
+					"Entry": entry,
+				},
+			}
+		}
+
+		if col.IndexRoute != "" {
+			man.Routes[col.IndexRoute] = Route{
+				Template: col.IndexTemplate,
+				Args: map[string]any{
+					"Entries": entries,
+				},
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// exportWorkers is how many routes are rendered concurrently during a
+// static export. There's no tuning knob for this yet; it's cheap enough
+// in-process that a fixed pool is plenty.
+const exportWorkers = 8
+
+// export walks every route in the handler's current manifest, renders it
+// in-process (no TCP, no subprocess), and writes the result under dir.
+// It also crawls the rendered HTML for same-origin links that aren't in
+// the manifest, so assets referenced only from markup still get written.
+//
+// This replaces shelling out to `wget -r`, which required wget on PATH,
+// couldn't see unlinked routes, and produced an awkward directory layout.
+func (h *handler) export(dir string) error {
+	loaded := h.cached.Load()
+	man := loaded.man
+
+	var (
+		mu      sync.Mutex
+		queued  = map[string]bool{}
+		hashes  = map[string]string{} // path -> sha256 of its exported bytes
+		jobs    = make(chan string)
+		results = make(chan error, exportWorkers)
+		wg      sync.WaitGroup
+	)
+
+	enqueue := func(p string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if queued[p] {
+			return
+		}
+		queued[p] = true
+		wg.Add(1)
+		go func() { jobs <- p }()
+	}
+
+	for p := range man.Routes {
+		enqueue(p)
+	}
+
+	for i := 0; i < exportWorkers; i++ {
+		go func() {
+			for p := range jobs {
+				err := h.exportRoute(dir, loaded, p, enqueue, func(p, sum string) {
+					mu.Lock()
+					hashes[p] = sum
+					mu.Unlock()
+				})
+				if err != nil {
+					results <- fmt.Errorf("error exporting %q: %s", p, err)
+				}
+				wg.Done()
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		// Safe once every enqueued item has been processed: an item's
+		// wg.Done only fires after its send on jobs (and any further
+		// enqueue calls it made) has already completed.
+		close(jobs)
+		close(results)
+	}()
+
+	for err := range results {
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeSitemap(dir, man); err != nil {
+		return fmt.Errorf("error writing sitemap: %s", err)
+	}
+	if err := writeAssetManifest(dir, hashes); err != nil {
+		return fmt.Errorf("error writing asset manifest: %s", err)
+	}
+
+	return nil
+}
+
+// exportRoute renders a single route via httptest and writes it to disk,
+// then (for HTML responses) scans it for same-origin links that aren't
+// already in the manifest and hands them to enqueue.
+//
+// A route discovered only via a link (not in the manifest) has nothing to
+// render, so it's instead copied straight off disk at the same path,
+// relative to the manifest directory - that's how markup ends up
+// referencing images, fonts, etc. that were never hand-registered as
+// routes.
+func (h *handler) exportRoute(
+	dir string,
+	loaded *loadedManifest,
+	routePath string,
+	enqueue func(string),
+	recordHash func(path, sum string),
+) error {
+	route, ok := loaded.man.Routes[routePath]
+	if !ok {
+		return exportDiscoveredAsset(dir, h.manifestDir, routePath, recordHash)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, routePath, nil)
+	h.serveRoute(rec, req, routePath, route, loaded)
+	body := rec.Body.Bytes()
+
+	// A broken render (template error, missing static file) would
+	// otherwise be written to disk as if it were the real page, silently
+	// turning a broken build green. Fail loudly instead.
+	if rec.Code < 200 || rec.Code >= 300 {
+		return fmt.Errorf("route rendered status %d: %s", rec.Code, body)
+	}
+
+	sum := sha256.Sum256(body)
+	recordHash(routePath, hex.EncodeToString(sum[:]))
+
+	outPath := exportFilePath(routePath, route, rec.Header().Get("Content-Type"))
+	fullPath := filepath.Join(dir, outPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fullPath, body, 0o644); err != nil {
+		return err
+	}
+
+	if isHTML(rec.Header().Get("Content-Type"), route) {
+		for _, link := range discoverLinks(body) {
+			enqueue(link)
+		}
+	}
+
+	return nil
+}
+
+// exportDiscoveredAsset copies a same-origin path discovered in rendered
+// markup, but not registered as a manifest route, straight from disk. A
+// path that doesn't resolve to a real file is logged and skipped rather
+// than failing the whole export - plenty of discovered links point at
+// other pages, not bare assets.
+func exportDiscoveredAsset(dir, manifestDir, routePath string, recordHash func(path, sum string)) error {
+	srcPath := filepath.Join(manifestDir, filepath.FromSlash(strings.TrimPrefix(routePath, "/")))
+	byts, err := os.ReadFile(srcPath)
+	if err != nil {
+		slog.Warn("export: discovered link does not resolve to a file, skipping", "path", routePath, "err", err)
+		return nil
+	}
+
+	sum := sha256.Sum256(byts)
+	recordHash(routePath, hex.EncodeToString(sum[:]))
+
+	outPath := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(routePath, "/")))
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, byts, 0o644)
+}
+
+// exportFilePath decides where a route's rendered body lands on disk.
+// Static/asset routes keep their own file name, gaining an extension from
+// their ContentType only when the path has none. Any other route whose
+// path ends in "/" or has no extension is treated as a page and written
+// as `<path>/index.html` so it's servable by any plain file server; a
+// path that already has an extension is written as is.
+func exportFilePath(routePath string, route Route, contentType string) string {
+	clean := strings.TrimPrefix(routePath, "/")
+
+	if route.StaticPath != "" {
+		// Static/asset routes are registered under their real file name
+		// (e.g. "/css/style.css"), so that's already the right path.
+		if filepath.Ext(clean) != "" {
+			return filepath.FromSlash(clean)
+		}
+		if exts, _ := mime.ExtensionsByType(route.ContentType); len(exts) > 0 {
+			return filepath.FromSlash(clean) + exts[0]
+		}
+		return filepath.FromSlash(clean)
+	}
+
+	// Templated routes are pages: write them as `<path>/index.html` unless
+	// the path already names a file with an extension.
+	if clean == "" || strings.HasSuffix(routePath, "/") || filepath.Ext(clean) == "" {
+		return filepath.FromSlash(path.Join(clean, "index.html"))
+	}
+	return filepath.FromSlash(clean)
+}
+
+func isHTML(contentType string, route Route) bool {
+	if contentType == "" {
+		return route.Template != ""
+	}
+	return strings.HasPrefix(contentType, "text/html")
+}
+
+// discoverLinks parses an HTML document and returns the path component of
+// every root-relative (leading "/", no scheme or host) link it finds in an
+// href/src attribute. Document-relative links such as "img/a.png" are not
+// returned.
+func discoverLinks(body []byte) []string {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		slog.Error("export: error parsing html for link discovery", "err", err)
+		return nil
+	}
+
+	var links []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, attr := range n.Attr {
+				if attr.Key != "href" && attr.Key != "src" {
+					continue
+				}
+				if p := sameOriginPath(attr.Val); p != "" {
+					links = append(links, p)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return links
+}
+
+// sameOriginPath returns the path component of href if it's root-relative
+// (no scheme, no host, leading "/"), or "" if it's external, a fragment,
+// mailto-style, or relative to the current document.
+func sameOriginPath(href string) string {
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	if strings.Contains(href, "://") || strings.HasPrefix(href, "//") {
+		return ""
+	}
+	if strings.HasPrefix(href, "mailto:") || strings.HasPrefix(href, "tel:") {
+		return ""
+	}
+	if idx := strings.IndexAny(href, "?#"); idx != -1 {
+		href = href[:idx]
+	}
+	if href == "" {
+		return ""
+	}
+	if !strings.HasPrefix(href, "/") {
+		return ""
+	}
+	return href
+}
+
+// writeSitemap emits a basic sitemap.xml listing every route in the
+// manifest, as a side effect of exporting.
+func writeSitemap(dir string, man *Manifest) error {
+	type urlEntry struct {
+		Loc string `xml:"loc"`
+	}
+	type urlSet struct {
+		XMLName xml.Name   `xml:"urlset"`
+		XMLNS   string     `xml:"xmlns,attr"`
+		URLs    []urlEntry `xml:"url"`
+	}
+
+	set := urlSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for p := range man.Routes {
+		set.URLs = append(set.URLs, urlEntry{Loc: p})
+	}
+
+	out, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append([]byte(xml.Header), out...)
+
+	return os.WriteFile(filepath.Join(dir, "sitemap.xml"), out, 0o644)
+}
+
+// writeAssetManifest records the sha256 of every exported route's body,
+// keyed by route path, so downstream tooling (CDN invalidation, cache
+// busting) doesn't have to re-hash the build output itself.
+func writeAssetManifest(dir string, hashes map[string]string) error {
+	byts, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "asset-manifest.json"), byts, 0o644)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/jdholdren/smolblog/internal/atom"
+)
+
+// feedContentTypes maps a [FeedSpec.Format] to the media type the response
+// should be served with.
+var feedContentTypes = map[string]string{
+	"atom": "application/atom+xml",
+	"rss":  "application/rss+xml",
+	"json": "application/json",
+}
+
+// renderFeed renders a route's feed into memory and returns its body and
+// content type. It's called from serveRoute before the static/template
+// branches, since a feed route has neither a StaticPath nor a Template.
+//
+// Rendering into a buffer, rather than straight to the ResponseWriter,
+// keeps feeds consistent with templated routes: a mid-encode error is
+// caught before anything is written, and the body can be hashed for an
+// ETag same as any other route.
+func renderFeed(spec *FeedSpec, collections map[string][]CollectionEntry) (body []byte, contentType string, err error) {
+	contentType, ok := feedContentTypes[spec.Format]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown feed format %q", spec.Format)
+	}
+
+	meta := atom.Meta{
+		SiteTitle:   spec.SiteTitle,
+		BaseURL:     spec.BaseURL,
+		Author:      spec.Author,
+		Description: spec.Description,
+	}
+	entries := feedEntries(collections[spec.Collection])
+
+	var buf bytes.Buffer
+	switch spec.Format {
+	case "atom":
+		err = atom.RenderAtom(&buf, meta, entries)
+	case "rss":
+		err = atom.RenderRSS(&buf, meta, entries)
+	case "json":
+		err = atom.RenderJSONFeed(&buf, meta, entries)
+	default:
+		err = fmt.Errorf("unknown feed format %q", spec.Format)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), contentType, nil
+}
+
+// feedEntries adapts collection entries (front matter + rendered HTML) to
+// the shape the atom package works with.
+func feedEntries(collEntries []CollectionEntry) []atom.Entry {
+	entries := make([]atom.Entry, 0, len(collEntries))
+	for _, e := range collEntries {
+		entries = append(entries, atom.Entry{
+			Slug:      e.Meta.Slug,
+			Title:     e.Meta.Title,
+			Path:      e.Path,
+			Published: e.Meta.Date,
+			Updated:   e.Meta.Date,
+			Summary:   e.Excerpt,
+			Content:   string(e.Content),
+		})
+	}
+	return entries
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Mode controls whether the handler caches its manifest/templates or
+// reloads them as the underlying files change.
+type Mode string
+
+const (
+	// ModeProd parses the manifest and templates once, at startup, and
+	// never reloads them. Static and markdown files are still read from
+	// disk when a route uses them.
+	ModeProd Mode = "prod"
+	// ModeDev watches the manifest and its dependent files, reparsing
+	// and swapping the cache whenever one of them changes.
+	ModeDev Mode = "dev"
+)
+
+// Does the serving of each request and holds dependencies of executing said requests.
+//
+// The current manifest and templates are held behind `cached`, an atomic
+// pointer so reloads (dev mode) never race a request that's mid-flight.
+// If unable to serve the request, it will return an error code.
+type handler struct {
+	manifestPath string // Points to the manifest
+	// Points to the parent directory of the manifest.
+	// This is so paths in the manifest can be relative to the manifest itself.
+	manifestDir string
+
+	mode   Mode
+	cached atomic.Pointer[loadedManifest]
+}
+
+// Sets the manifest path on a new handler as well as the manifest directory
+// so requests have access to it for resolving relative paths.
+//
+// In [ModeProd] the manifest is loaded once here and any error is returned
+// immediately rather than surfacing on the first request. In [ModeDev] an
+// initial load still happens so the server can serve something right away,
+// but a watcher (see watch.go) keeps it fresh afterward.
+func newHandler(manPath string, mode Mode) (*handler, error) {
+	h := &handler{
+		manifestPath: manPath,
+		manifestDir:  filepath.Dir(manPath),
+		mode:         mode,
+	}
+
+	loaded, err := loadManifest(h.manifestPath, h.manifestDir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifest: %s", err)
+	}
+	h.cached.Store(loaded)
+
+	return h, nil
+}
+
+// This holds the data getting passed to the template being executed,
+// as well as information about the current path being handled.
+type routeArgs struct {
+	// The path of the current route
+	Path string
+	// The args from the manifest
+	Args map[string]any
+}
+
+// ServeHTTP implements [http.Handler] for each request.
+//
+// It only serves GET's.
+// It looks up the route in the manifest, and if it's present, it executes the logic of the route: If the route is not found, it returns a 404.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slog.Info("request received",
+		"method", r.Method,
+		"location", r.URL.String(),
+	)
+
+	// Only respond to GETs, otherwise respond 405
+	if method := r.Method; method != http.MethodGet {
+		slog.Error("method not allowed", "method", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The cache is swapped out by the dev-mode watcher as files change;
+	// in prod mode it's simply whatever was loaded at startup.
+	loaded := h.cached.Load()
+	man := loaded.man
+
+	// Check that the route exists, if not: 404
+	path := r.URL.Path
+	route, ok := man.Routes[path] // Ignore fragments, query string etc
+	if !ok {
+		slog.Error("route not found", "path", path)
+		http.Error(w, "route not found", http.StatusNotFound)
+		return
+	}
+
+	h.serveRoute(w, r, path, route, loaded)
+}
+
+// serveRoute executes a single, already-resolved route against the given
+// manifest revision. Split out of ServeHTTP so the exporter (export.go)
+// can drive routes directly without going through net/http.
+func (h *handler) serveRoute(w http.ResponseWriter, r *http.Request, path string, route Route, loaded *loadedManifest) {
+	policy, hasPolicy := cachePolicyFor(path, loaded.man.Cache)
+
+	// A feed route has neither a StaticPath nor a Template: it's rendered
+	// entirely from a collection's entries.
+	if route.Feed != nil {
+		body, contentType, err := renderFeed(route.Feed, loaded.collections)
+		if err != nil {
+			slog.Error("error rendering feed", "route", route, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		etag := bodyETag(body)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", etag)
+		writeCacheControl(w, policy, hasPolicy)
+		if isNotModified(r, etag, time.Time{}) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if err := writeBody(w, r, body); err != nil {
+			slog.Error("error writing feed", "route", route, "err", err)
+		}
+		return
+	}
+
+	// If the path has a `StaticPath`, then just read and serve the file.
+	// Since the route has been registered, any error here is a 500, including
+	// if the file could not be found.
+	if sPath := route.StaticPath; sPath != "" {
+		meta := loaded.staticMeta[path]
+		w.Header().Set("ETag", meta.ETag)
+		w.Header().Set("Last-Modified", meta.ModTime.UTC().Format(http.TimeFormat))
+		writeCacheControl(w, policy, hasPolicy)
+
+		if isNotModified(r, meta.ETag, meta.ModTime) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		fPath := filepath.Join(h.manifestDir, sPath)
+		f, err := os.ReadFile(fPath)
+		if err != nil {
+			slog.Error("error reading file", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Write the content type out if there is one, so css/js files are parsed correctly
+		if route.ContentType != "" {
+			w.Header().Set("Content-Type", route.ContentType)
+		}
+		if err := writeBody(w, r, f); err != nil {
+			// Headers (and possibly part of the compressed body) are
+			// already flushed at this point, so there's no status left to
+			// correct - just log it.
+			slog.Error("error writing file", "err", err)
+			return
+		}
+
+		// Do not continue to handle it as a templated route
+		return
+	}
+
+	// Each route is a template + arguments, so handling the route is just
+	// executing the template named in the route's `Template` field with the `Args` field.
+	//
+	// Rendered into a buffer first rather than straight to the response:
+	// that's both what lets us hash the body for an ETag, and what fixes
+	// the old bug where a mid-execution template error had already sent a
+	// 200 by the time it was caught.
+	var buf bytes.Buffer
+	if err := loaded.tpls.ExecuteTemplate(
+		&buf,
+		route.Template,
+		routeArgs{
+			Path: path,
+			Args: route.Args,
+		},
+	); err != nil {
+		slog.Error("error executing route's template", "route", route, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := bodyETag(buf.Bytes())
+	w.Header().Set("ETag", etag)
+	writeCacheControl(w, policy, hasPolicy)
+	if isNotModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if err := writeBody(w, r, buf.Bytes()); err != nil {
+		slog.Error("error writing response", "route", route, "err", err)
+	}
+}
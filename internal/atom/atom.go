@@ -0,0 +1,218 @@
+// Package atom renders a collection's entries as an Atom feed, an RSS 2.0
+// feed, or a JSON Feed 1.1 document, without needing a hand-written
+// template for any of them.
+package atom
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Meta is the site-level information a feed needs that isn't carried by
+// any single entry.
+type Meta struct {
+	SiteTitle   string
+	BaseURL     string
+	Author      string
+	Description string
+}
+
+// Entry is one item in a feed, built from a collection entry's front
+// matter and rendered content.
+type Entry struct {
+	Slug      string
+	Title     string
+	Path      string // site-relative, e.g. "/blog/hello-world/"
+	Published time.Time
+	Updated   time.Time
+	Summary   string
+	Content   string
+}
+
+// id returns a tag: URI for e, per RFC 4151, derived from the site's
+// domain and the entry's first-publish date and slug. Tag URIs are
+// stable even if the entry's path later changes.
+func (m Meta) id(e Entry) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(m.BaseURL, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	host, _, _ = strings.Cut(host, ":")
+	return fmt.Sprintf("tag:%s,%04d-%02d-%02d:%s", host, e.Published.Year(), e.Published.Month(), e.Published.Day(), e.Slug)
+}
+
+func (m Meta) link(e Entry) string {
+	return strings.TrimSuffix(m.BaseURL, "/") + e.Path
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Link      atomLink `xml:"link"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Summary   string   `xml:"summary"`
+	Content   atomHTML `xml:"content"`
+}
+
+type atomHTML struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",cdata"`
+}
+
+// RenderAtom writes entries as an Atom 1.0 feed to w.
+func RenderAtom(w io.Writer, m Meta, entries []Entry) error {
+	feed := atomFeed{
+		Title: m.SiteTitle,
+		ID:    strings.TrimSuffix(m.BaseURL, "/") + "/",
+		Link:  atomLink{Href: m.BaseURL},
+	}
+	if m.Author != "" {
+		feed.Author = &atomAuthor{Name: m.Author}
+	}
+
+	var latest time.Time
+	for _, e := range entries {
+		if e.Updated.After(latest) {
+			latest = e.Updated
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        m.id(e),
+			Title:     e.Title,
+			Link:      atomLink{Href: m.link(e)},
+			Published: e.Published.Format(time.RFC3339),
+			Updated:   e.Updated.Format(time.RFC3339),
+			Summary:   e.Summary,
+			Content:   atomHTML{Type: "html", Body: e.Content},
+		})
+	}
+	feed.Updated = latest.Format(time.RFC3339)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name  `xml:"rss"`
+	Version string    `xml:"version,attr"`
+	Channel rssChanel `xml:"channel"`
+}
+
+type rssChanel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+// RenderRSS writes entries as an RSS 2.0 feed to w.
+func RenderRSS(w io.Writer, m Meta, entries []Entry) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChanel{
+			Title:       m.SiteTitle,
+			Link:        m.BaseURL,
+			Description: m.Description,
+		},
+	}
+	for _, e := range entries {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        m.link(e),
+			GUID:        m.id(e),
+			PubDate:     e.Published.Format(time.RFC1123Z),
+			Description: e.Summary,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description,omitempty"`
+	Author      *jsonFeedAuth  `json:"author,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedAuth struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	ContentHTML   string `json:"content_html"`
+	Summary       string `json:"summary,omitempty"`
+	DatePublished string `json:"date_published"`
+	DateModified  string `json:"date_modified"`
+}
+
+// RenderJSONFeed writes entries as a JSON Feed 1.1 document to w.
+func RenderJSONFeed(w io.Writer, m Meta, entries []Entry) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       m.SiteTitle,
+		HomePageURL: m.BaseURL,
+		Description: m.Description,
+	}
+	if m.Author != "" {
+		feed.Author = &jsonFeedAuth{Name: m.Author}
+	}
+	for _, e := range entries {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            m.id(e),
+			URL:           m.link(e),
+			Title:         e.Title,
+			ContentHTML:   e.Content,
+			Summary:       e.Summary,
+			DatePublished: e.Published.Format(time.RFC3339),
+			DateModified:  e.Updated.Format(time.RFC3339),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(feed)
+}
@@ -0,0 +1,100 @@
+// Package markdown builds a goldmark pipeline from a manifest's
+// `markdown` block, so every caller in smolblog (templates, collections,
+// feeds) renders markdown the same configured way instead of each
+// constructing its own one-off goldmark instance.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	ghtml "github.com/yuin/goldmark/renderer/html"
+	"go.abhg.dev/goldmark/toc"
+)
+
+// Config is the `markdown` block of a [Manifest], controlling which
+// goldmark extensions are turned on.
+type Config struct {
+	GFM           bool      `json:"gfm"`
+	Footnotes     bool      `json:"footnotes"`
+	AutoHeadingID bool      `json:"auto_heading_id"`
+	TOC           bool      `json:"toc"`
+	Highlight     Highlight `json:"highlight"`
+	// UnsafeHTML allows raw HTML embedded in markdown source through to
+	// the rendered output. Off by default: goldmark drops raw HTML
+	// unless this is explicitly turned on, since content usually comes
+	// from collection files that aren't fully trusted input.
+	UnsafeHTML bool `json:"unsafe_html"`
+}
+
+// Highlight configures Chroma-based syntax highlighting of fenced code
+// blocks.
+type Highlight struct {
+	Enabled bool   `json:"enabled"`
+	Style   string `json:"style"`
+}
+
+// Renderer is a goldmark pipeline built once from a [Config] and reused
+// for every markdown file or string rendered for the lifetime of a
+// manifest revision.
+type Renderer struct {
+	md goldmark.Markdown
+}
+
+// New builds a Renderer from cfg. A zero Config still renders plain
+// CommonMark; every extension beyond that is opt-in.
+func New(cfg Config) *Renderer {
+	var (
+		exts       []goldmark.Extender
+		parserOpts []parser.Option
+	)
+
+	if cfg.GFM {
+		exts = append(exts, extension.GFM)
+	}
+	if cfg.Footnotes {
+		exts = append(exts, extension.Footnote)
+	}
+	if cfg.TOC {
+		exts = append(exts, &toc.Extender{})
+	}
+	if cfg.Highlight.Enabled {
+		style := cfg.Highlight.Style
+		if style == "" {
+			style = "github"
+		}
+		exts = append(exts, highlighting.NewHighlighting(
+			highlighting.WithStyle(style),
+		))
+	}
+	if cfg.AutoHeadingID {
+		parserOpts = append(parserOpts, parser.WithAutoHeadingID())
+	}
+
+	var rendererOpts []renderer.Option
+	if cfg.UnsafeHTML {
+		rendererOpts = append(rendererOpts, ghtml.WithUnsafe())
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(exts...),
+		goldmark.WithParserOptions(parserOpts...),
+		goldmark.WithRendererOptions(rendererOpts...),
+	)
+
+	return &Renderer{md: md}
+}
+
+// Render converts src to HTML using the configured pipeline.
+func (r *Renderer) Render(src []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := r.md.Convert(src, &buf); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+
+	"github.com/jdholdren/smolblog/internal/markdown"
+)
+
+type (
+	// Manifest is the structure of the data driving the web server.
+	//
+	// It has two main pieces:
+	// - `layouts`, which are any templates that are globbed
+	// - `rotues`, which are registered as get routes and served by the handler
+	Manifest struct {
+		Layouts     []string              `json:"layouts"`
+		Routes      map[string]Route      `json:"routes"`
+		Collections map[string]Collection `json:"collections"`
+		Markdown    markdown.Config       `json:"markdown"`
+		// Cache maps a route path pattern (matched with [path.Match]) to
+		// the caching policy responses for it should advertise.
+		Cache map[string]CachePolicy `json:"cache"`
+	}
+
+	// Route is a registered path that is run when a GET request is made to it.
+	Route struct {
+		// If the route is simply a static file
+		StaticPath  string `json:"static_path"`
+		ContentType string `json:"content_type"`
+		// The name of the template to execute first
+		Template string `json:"template"`
+		// Any arbitrary arguments to be used in executing the template
+		Args map[string]any `json:"args"`
+		// If set, the route is served as a feed over its collection
+		// instead of through a template. See feeds.go.
+		Feed *FeedSpec `json:"feed,omitempty"`
+	}
+
+	// FeedSpec turns a route into an Atom, RSS, or JSON Feed document
+	// built from one of the manifest's collections.
+	FeedSpec struct {
+		Collection  string `json:"collection"`
+		Format      string `json:"format"` // "atom", "rss", or "json"
+		SiteTitle   string `json:"site_title"`
+		BaseURL     string `json:"base_url"`
+		Author      string `json:"author"`
+		Description string `json:"description"`
+	}
+
+	// CachePolicy controls the `Cache-Control` header written for routes
+	// matching the pattern it's keyed under in [Manifest.Cache].
+	CachePolicy struct {
+		MaxAge    int  `json:"max_age"`
+		Immutable bool `json:"immutable"`
+	}
+)
+
+// loadedManifest is the result of a successful [loadManifest] call: the
+// parsed manifest alongside the templates built from its layouts.
+//
+// This is what gets cached behind the handler's atomic pointer so a
+// request never has to parse anything itself.
+type loadedManifest struct {
+	man         *Manifest
+	tpls        *template.Template
+	collections map[string][]CollectionEntry
+	// staticMeta holds the ETag/Last-Modified for every StaticPath route,
+	// computed once here instead of on every request.
+	staticMeta map[string]staticAssetMeta
+}
+
+// Returns the manifest and loads any layouts specified in the manifest.
+func loadManifest(manifestPath, manifestDir string) (*loadedManifest, error) {
+	// Reading and parsing of the manifest.
+	// This will determine where the layouts are and what to parse next.
+	byts, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manfiest: %s", err)
+	}
+
+	var man Manifest
+	if err := json.Unmarshal(byts, &man); err != nil {
+		return nil, fmt.Errorf("error unmarshaling manifest: %s", err)
+	}
+	if man.Routes == nil {
+		man.Routes = map[string]Route{}
+	}
+
+	// Built once per manifest revision so every markdown file/string in
+	// this load (collections, template funcs) renders through the same
+	// configured pipeline.
+	md := markdown.New(man.Markdown)
+
+	// Collections are markdown files with front matter that get turned
+	// into routes, same as anything hand-written in the manifest.
+	collections := map[string][]CollectionEntry{}
+	for name, col := range man.Collections {
+		entries, err := loadCollectionEntries(manifestDir, col, md)
+		if err != nil {
+			return nil, fmt.Errorf("error loading collection %q: %s", name, err)
+		}
+		collections[name] = entries
+	}
+	synthesizeCollectionRoutes(&man, collections)
+
+	// Parsing layouts happens here, putting them on the `handler` struct
+	// for usage when responding to a request.
+	//
+	// Filepaths for layouts are relative to the manifest's path, so
+	// they must be joined to the manifest path to properly resolve.
+	paths := make([]string, 0, len(man.Layouts))
+	for _, l := range man.Layouts {
+		path := filepath.Join(manifestDir, l)
+		paths = append(paths, path)
+	}
+	tpls, err := template.New("").
+		Funcs(templateFuncs(manifestDir, collections, md)).
+		ParseFiles(paths...)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing layouts: %s", err)
+	}
+
+	staticMeta, err := computeStaticMeta(manifestDir, man.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing static routes: %s", err)
+	}
+
+	return &loadedManifest{man: &man, tpls: tpls, collections: collections, staticMeta: staticMeta}, nil
+}
+
+// watchedFiles returns every file on disk that, if it changed, should
+// trigger a reload: the manifest itself, its layouts, and any static or
+// markdown files referenced from route args.
+func watchedFiles(manifestPath, manifestDir string, man *Manifest) []string {
+	files := []string{manifestPath}
+	for _, l := range man.Layouts {
+		files = append(files, filepath.Join(manifestDir, l))
+	}
+
+	for _, route := range man.Routes {
+		if route.StaticPath != "" {
+			files = append(files, filepath.Join(manifestDir, route.StaticPath))
+		}
+		for _, src := range markdownArgs(route.Args) {
+			files = append(files, filepath.Join(manifestDir, src))
+		}
+	}
+
+	for _, col := range man.Collections {
+		matches, _ := filepath.Glob(filepath.Join(manifestDir, col.Glob))
+		files = append(files, matches...)
+	}
+
+	return files
+}
+
+// markdownArgs walks a route's args looking for string values that look
+// like a path to a markdown file, so dev mode can watch them too.
+func markdownArgs(args map[string]any) []string {
+	var found []string
+	for _, v := range args {
+		switch val := v.(type) {
+		case string:
+			if filepath.Ext(val) == ".md" {
+				found = append(found, val)
+			}
+		case map[string]any:
+			found = append(found, markdownArgs(val)...)
+		}
+	}
+	return found
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+
+	"github.com/jdholdren/smolblog/internal/markdown"
+)
+
+// Creates the template functions that can be used when executing.
+//
+// collections holds the already-loaded entries for every collection in the
+// manifest, so `posts`/`postsByTag`/`recentPosts` can be plain lookups
+// instead of re-parsing markdown on every template execution. md is the
+// single [markdown.Renderer] built from the manifest's `markdown` block,
+// so every markdown func here renders the same configured way.
+func templateFuncs(manifestDir string, collections map[string][]CollectionEntry, md *markdown.Renderer) template.FuncMap {
+	return template.FuncMap{
+		// Opens the given file (relative to the manifest), parses it as
+		// markdown, and returns the rendered HTML, unescaped. A bad file or
+		// a markdown error is returned to the template engine instead of
+		// panicking, so it surfaces as a logged 500 rather than crashing
+		// the serving goroutine.
+		"renderMarkdown": renderMarkdownFile(manifestDir, md),
+
+		// Same as `renderMarkdown`, kept under its own name since it's the
+		// more discoverable one for new templates.
+		"renderMarkdownFile": renderMarkdownFile(manifestDir, md),
+
+		// Renders a markdown string directly, with no file on disk.
+		"renderMarkdownString": func(src string) (template.HTML, error) {
+			return md.Render([]byte(src))
+		},
+
+		// Returns a file's front matter without rendering its body.
+		"markdownMeta": func(src string) (FrontMatter, error) {
+			path := filepath.Join(manifestDir, src)
+			byts, err := os.ReadFile(path)
+			if err != nil {
+				return FrontMatter{}, fmt.Errorf("error opening file to parse front matter: %s", err)
+			}
+
+			fm, _, err := parseFrontMatter(byts)
+			if err != nil {
+				return FrontMatter{}, fmt.Errorf("error parsing front matter: %s", err)
+			}
+			return fm, nil
+		},
+
+		// Returns every entry of the named collection, newest first.
+		"posts": func(name string) []CollectionEntry {
+			return collections[name]
+		},
+
+		// Returns every entry of the named collection tagged with tag.
+		"postsByTag": func(name, tag string) []CollectionEntry {
+			var tagged []CollectionEntry
+			for _, entry := range collections[name] {
+				for _, t := range entry.Meta.Tags {
+					if t == tag {
+						tagged = append(tagged, entry)
+						break
+					}
+				}
+			}
+			return tagged
+		},
+
+		// Returns the n newest entries of the named collection.
+		"recentPosts": func(name string, n int) []CollectionEntry {
+			if n < 0 {
+				n = 0
+			}
+			entries := collections[name]
+			if n < len(entries) {
+				entries = entries[:n]
+			}
+			return entries
+		},
+	}
+}
+
+// renderMarkdownFile returns a template func that reads src (relative to
+// manifestDir), renders it through md, and returns the resulting HTML.
+func renderMarkdownFile(manifestDir string, md *markdown.Renderer) func(string) (template.HTML, error) {
+	return func(src string) (template.HTML, error) {
+		path := filepath.Join(manifestDir, src)
+		byts, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("error opening file to parse markdown: %s", err)
+		}
+
+		rendered, err := md.Render(byts)
+		if err != nil {
+			return "", fmt.Errorf("error converting markdown: %s", err)
+		}
+		return rendered, nil
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// debounceWindow is how long the watcher waits after the last detected
+// change before actually reloading, so a burst of writes (editors often
+// save in several syscalls) only triggers a single reparse.
+const debounceWindow = 100 * time.Millisecond
+
+// watch keeps `h`'s cached manifest fresh for as long as ctx is alive.
+//
+// It watches the manifest itself, every layout, and any static/markdown
+// file referenced from the manifest's routes. Watches are re-derived
+// after every reload, since a new manifest revision can add or drop
+// files it depends on.
+func (h *handler) watch(ctx context.Context) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := h.addWatches(w); err != nil {
+		return err
+	}
+
+	var debounce *time.Timer
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("error from file watcher", "err", err)
+
+		case _, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+
+			// Reset (or start) the debounce timer; only the last event in a
+			// burst actually fires a reload.
+			if debounce == nil {
+				debounce = time.NewTimer(debounceWindow)
+			} else {
+				if !debounce.Stop() {
+					<-debounce.C
+				}
+				debounce.Reset(debounceWindow)
+			}
+
+		case <-debounceTimerC(debounce):
+			debounce = nil
+			if err := h.reload(w); err != nil {
+				slog.Error("error reloading manifest", "err", err)
+			}
+		}
+	}
+}
+
+// debounceTimerC returns t's channel, or nil if t hasn't been started yet.
+// A nil channel blocks forever in a select, which is exactly what's wanted
+// until the first fsnotify event arrives.
+func debounceTimerC(t *time.Timer) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.C
+}
+
+// reload reparses the manifest, swaps the handler's cache, and re-derives
+// the set of watched files for the new revision.
+func (h *handler) reload(w *fsnotify.Watcher) error {
+	loaded, err := loadManifest(h.manifestPath, h.manifestDir)
+	if err != nil {
+		return err
+	}
+	h.cached.Store(loaded)
+	slog.Info("manifest reloaded")
+
+	return h.addWatches(w)
+}
+
+// addWatches adds every file the current manifest depends on to w. Adding
+// a path that's already watched is a harmless no-op for fsnotify.
+func (h *handler) addWatches(w *fsnotify.Watcher) error {
+	loaded := h.cached.Load()
+	for _, f := range watchedFiles(h.manifestPath, h.manifestDir, loaded.man) {
+		if err := w.Add(f); err != nil {
+			slog.Error("error watching file", "file", f, "err", err)
+		}
+	}
+	return nil
+}